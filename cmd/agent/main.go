@@ -0,0 +1,129 @@
+// Command agent — эталонный gRPC-агент-вычислитель: подключается к AgentService
+// оркестратора, поднимает пул воркеров и в цикле забирает и считает задачи.
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/Powdersumm/andexlmscalcproject2sprint/internal/application/agentpb"
+)
+
+const (
+	defaultAddr           = "localhost:50051"
+	defaultComputingPower = 1
+	minReconnectBackoff   = time.Second
+	maxReconnectBackoff   = 30 * time.Second
+)
+
+func main() {
+	addr := os.Getenv("AGENT_ADDR")
+	if addr == "" {
+		addr = defaultAddr
+	}
+
+	power := defaultComputingPower
+	if v := os.Getenv("COMPUTING_POWER"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			power = parsed
+		}
+	}
+
+	log.Printf("запуск агента: addr=%s, computing_power=%d", addr, power)
+
+	for i := 0; i < power; i++ {
+		go runWorker(addr)
+	}
+	select {}
+}
+
+// runWorker – один воркер пула: держит свой gRPC-стрим к оркестратору и
+// переподключается с экспоненциальной задержкой при обрыве соединения.
+func runWorker(addr string) {
+	backoff := minReconnectBackoff
+	for {
+		if err := serveStream(addr); err != nil {
+			log.Printf("поток агента прерван: %v, переподключение через %s", err, backoff)
+			time.Sleep(backoff)
+			backoff *= 2
+			if backoff > maxReconnectBackoff {
+				backoff = maxReconnectBackoff
+			}
+			continue
+		}
+		backoff = minReconnectBackoff
+	}
+}
+
+// serveStream – открывает один стрим AgentService и обрабатывает задачи, пока
+// соединение не оборвётся
+func serveStream(addr string) error {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client := agentpb.NewAgentServiceClient(conn)
+	stream, err := client.Stream(context.Background())
+	if err != nil {
+		return err
+	}
+
+	// Первое сообщение сигнализирует готовность принять задачу.
+	if err := stream.Send(&agentpb.AgentMessage{Payload: &agentpb.AgentMessage_Ready{Ready: true}}); err != nil {
+		return err
+	}
+
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		task := msg.GetTask()
+		if task == nil {
+			continue
+		}
+
+		result := compute(task)
+
+		if err := stream.Send(&agentpb.AgentMessage{Payload: &agentpb.AgentMessage_Result{Result: result}}); err != nil {
+			return err
+		}
+	}
+}
+
+// compute – вычисляет одну задачу, выдерживая заданное оркестратором время операции
+func compute(task *agentpb.Task) *agentpb.TaskResult {
+	time.Sleep(time.Duration(task.GetOperationTimeMs()) * time.Millisecond)
+
+	var value float64
+	switch task.GetOperation() {
+	case "+":
+		value = task.GetArg1() + task.GetArg2()
+	case "-":
+		value = task.GetArg1() - task.GetArg2()
+	case "*":
+		value = task.GetArg1() * task.GetArg2()
+	case "/":
+		if task.GetArg2() == 0 {
+			return &agentpb.TaskResult{Id: task.GetId(), Error: "деление на ноль"}
+		}
+		value = task.GetArg1() / task.GetArg2()
+	default:
+		return &agentpb.TaskResult{Id: task.GetId(), Error: "неизвестная операция: " + task.GetOperation()}
+	}
+
+	return &agentpb.TaskResult{Id: task.GetId(), Result: value}
+}
@@ -4,15 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"math"
 	"net/http"
 	"os"
+	"strconv"
 	"sync"
-	"time"
 
-	"github.com/Knetic/govaluate"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Request – структура входящего запроса с выражением
@@ -28,24 +27,30 @@ type Expression struct {
 	Expression string  `json:"expression"`
 	Status     string  `json:"status"`
 	Result     float64 `json:"result,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	RootTaskID string  `json:"-"`
 }
 
-// Task – структура задачи для вычисления
-type Task struct {
-	ID            string  `json:"id"`
-	Arg1          float64 `json:"arg1"`
-	Arg2          float64 `json:"arg2"`
-	Operation     string  `json:"operation"`
-	OperationTime int64   `json:"operation_time"`
-}
-
-// Глобальные переменные для хранения выражений и очереди задач
+// Глобальные переменные для хранения выражений
 var expressions = make(map[string]*Expression)
-var tasks = make(chan Task, 10) // Буферизованный канал для задач
 
 // Config – конфигурация приложения
 type Config struct {
 	Addr string
+
+	// GRPCAddr – адрес gRPC-сервера AgentService, альтернативного HTTP-транспорта
+	// для агентов. Пуст по умолчанию — в этом случае gRPC-сервер не запускается.
+	GRPCAddr string
+
+	TimeAdditionMS       int64
+	TimeSubtractionMS    int64
+	TimeMultiplicationMS int64
+	TimeDivisionMS       int64
+
+	TaskLeaseMS     int64
+	TaskMaxAttempts int
+
+	StoragePath string
 }
 
 // ConfigFromEnv – загрузка конфигурации из переменных окружения
@@ -55,79 +60,124 @@ func ConfigFromEnv() *Config {
 	if config.Addr == "" {
 		config.Addr = "8080"
 	}
+
+	config.TimeAdditionMS = envInt64("TIME_ADDITION_MS", 100)
+	config.TimeSubtractionMS = envInt64("TIME_SUBTRACTION_MS", 100)
+	config.TimeMultiplicationMS = envInt64("TIME_MULTIPLICATION_MS", 200)
+	config.TimeDivisionMS = envInt64("TIME_DIVISION_MS", 200)
+
+	// TaskLeaseMS = 0 означает "не задано": длительность аренды задачи будет
+	// вычисляться как 2 * OperationTime конкретной задачи
+	config.TaskLeaseMS = envInt64("TASK_LEASE_MS", 0)
+	config.TaskMaxAttempts = int(envInt64("TASK_MAX_ATTEMPTS", 3))
+
+	// STORAGE_PATH пуст по умолчанию — в этом случае используется MemoryStore без персистентности
+	config.StoragePath = os.Getenv("STORAGE_PATH")
+
+	if grpcPort := os.Getenv("GRPC_PORT"); grpcPort != "" {
+		config.GRPCAddr = ":" + grpcPort
+	}
+
 	return config
 }
 
+// envInt64 – читает переменную окружения как int64, возвращая значение по умолчанию при её отсутствии или ошибке парсинга
+func envInt64(key string, def int64) int64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	parsed, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return def
+	}
+	return parsed
+}
+
 // Application – основная структура приложения
 type Application struct {
 	config *Config
+	store  Store
 }
 
 // New – создание нового экземпляра приложения
 func New() *Application {
+	config := ConfigFromEnv()
+
+	store, err := newStore(config)
+	if err != nil {
+		log.Fatalf("не удалось инициализировать хранилище: %v", err)
+	}
+
 	return &Application{
-		config: ConfigFromEnv(),
+		config: config,
+		store:  store,
 	}
 }
 
+// newStore – выбирает реализацию Store в зависимости от конфигурации:
+// BoltDB, если задан STORAGE_PATH, иначе MemoryStore без персистентности
+func newStore(config *Config) (Store, error) {
+	if config.StoragePath == "" {
+		return NewMemoryStore(), nil
+	}
+	return NewBoltStore(config.StoragePath)
+}
+
 // generateUniqueID – генерация уникального идентификатора
 func generateUniqueID() string {
 	return uuid.New().String()
 }
 
-// parseExpression – функция для парсинга математического выражения в формате "<number> <operator> <number>"
-func parseComplexExpression(expr string) (float64, error) {
-	ev, err := govaluate.NewEvaluableExpression(expr)
-	if err != nil {
-		return 0, fmt.Errorf("ошибка при парсинге выражения: %v", err)
-	}
-	result, err := ev.Evaluate(nil)
-	if err != nil {
-		return 0, fmt.Errorf("ошибка при вычислении: %v", err)
-	}
-	return result.(float64), nil
-}
-
-// AddExpressionHandler – обработчик POST-запроса для добавления нового выражения
-func AddExpressionHandler(w http.ResponseWriter, r *http.Request) {
+// AddExpressionHandler – обработчик POST-запроса для добавления нового выражения.
+// Выражение раскладывается в граф задач (AST), листовые задачи сразу попадают в очередь на выполнение.
+func (a *Application) AddExpressionHandler(w http.ResponseWriter, r *http.Request) {
 	var req Request
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid expression payload", http.StatusBadRequest)
 		return
 	}
 
-	// Используем функцию parseComplexExpression для вычисления результата
-	result, err := parseComplexExpression(req.Expression)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	// Генерация уникального ID для выражения
 	expressionID := generateUniqueID()
-
 	expr := &Expression{
 		ID:         expressionID,
 		Expression: req.Expression,
 		Status:     "pending",
-		Result:     result, // Записываем результат сразу
 	}
 
-	// Защищаем доступ к глобальной карте expressions
+	rootID, literal, isLiteral, err := decomposeExpression(a.config, a.store, expressionID, req.Expression)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	expressionsMutex.Lock()
+	if isLiteral {
+		expr.Status = "completed"
+		expr.Result = literal
+	} else {
+		expr.RootTaskID = rootID
+	}
 	expressions[expressionID] = expr
 	expressionsMutex.Unlock()
 
-	// Возвращаем ответ с ID выражения
+	expressionsTotal.WithLabelValues(expr.Status).Inc()
+
+	if err := a.store.SaveExpression(expr); err != nil {
+		logger.Error("не удалось сохранить выражение", "expression_id", expressionID, "error", err)
+	}
+
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{"id": expressionID})
 }
 
 func GetExpressionsHandler(w http.ResponseWriter, r *http.Request) {
-	var expressionList []Expression
+	expressionsMutex.Lock()
+	expressionList := make([]Expression, 0, len(expressions))
 	for _, expr := range expressions {
 		expressionList = append(expressionList, *expr)
 	}
+	expressionsMutex.Unlock()
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -138,101 +188,132 @@ func GetExpressionsHandler(w http.ResponseWriter, r *http.Request) {
 func GetExpressionByIDHandler(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 
+	expressionsMutex.Lock()
 	expr, found := expressions[id]
+	var copied Expression
+	if found {
+		copied = *expr
+	}
+	expressionsMutex.Unlock()
 	if !found {
 		http.Error(w, "expression not found", http.StatusNotFound)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(expr)
+	json.NewEncoder(w).Encode(copied)
 }
 
-func GetTaskHandler(w http.ResponseWriter, r *http.Request) {
-	task, found := getNextTaskToProcess()
-	if !found {
-		http.Error(w, "no task available", http.StatusNotFound)
-		return
+// rehydrate – восстанавливает выражения и весь граф их задач из хранилища
+// после перезапуска оркестратора.
+//
+// Сначала полностью восстанавливается tasksByID из LoadTasks (включая задачи,
+// ещё ожидающие зависимостей, — иначе submitTaskResult не найдёт родителя
+// по ParentID, когда придёт результат его последнего ребёнка). Затем очередь
+// готовых задач вычитывается DequeueTask'ом и возвращается обратно в хранилище.
+// Наконец, задачи без незавершённых зависимостей, которые не вернулись через
+// очередь (они были выданы агенту и не подтверждены до перезапуска), считаются
+// оборванными в середине выполнения и ставятся в очередь заново.
+func (a *Application) rehydrate() error {
+	loaded, err := a.store.LoadExpressions()
+	if err != nil {
+		return fmt.Errorf("не удалось загрузить выражения из хранилища: %v", err)
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(task)
-}
-
-// Логика обработки задач
-func getNextTaskToProcess() (Task, bool) {
-	select {
-	case task := <-tasks:
-		return task, true
-	default:
-		return Task{}, false
+	expressionsMutex.Lock()
+	for id, expr := range loaded {
+		expressions[id] = expr
 	}
-}
+	expressionsMutex.Unlock()
 
-// Функция для выполнения вычислений
-func processTask(task Task) {
-	var result float64
-	switch task.Operation {
-	case "+":
-		result = task.Arg1 + task.Arg2
-	case "-":
-		result = task.Arg1 - task.Arg2
-	case "*":
-		result = task.Arg1 * task.Arg2
-	case "/":
-		if task.Arg2 == 0 {
-			log.Printf("Ошибка: деление на ноль в задаче с ID %s", task.ID)
-			return
-		}
-		result = task.Arg1 / task.Arg2
+	tasks, err := a.store.LoadTasks()
+	if err != nil {
+		return fmt.Errorf("не удалось загрузить задачи из хранилища: %v", err)
 	}
 
-	// Проверка на NaN или бесконечность
-	if math.IsNaN(result) || math.IsInf(result, 0) {
-		log.Printf("Ошибка: результат вычисления для задачи с ID %s некорректен: %v", task.ID, result)
-		return
+	tasksMutex.Lock()
+	for id, task := range tasks {
+		tasksByID[id] = task
 	}
+	tasksMutex.Unlock()
 
-	// Обновляем статус задачи на "completed" и сохраняем результат
-	expressionsMutex.Lock()
-	expr, found := expressions[task.ID]
-	if found {
-		expr.Status = "completed"
-		expr.Result = result
-	}
-	expressionsMutex.Unlock()
+	queued := make(map[string]bool, len(tasks))
+	restored := 0
+	for {
+		task, err := a.store.DequeueTask()
+		if err != nil {
+			return fmt.Errorf("не удалось восстановить очередь задач: %v", err)
+		}
+		if task == nil {
+			break
+		}
 
-	log.Printf("Задача с ID %s обработана, результат: %f", task.ID, result)
-}
+		tasksMutex.Lock()
+		tasksByID[task.ID] = task
+		tasksMutex.Unlock()
 
-// Запуск агента для обработки задач
-func startAgent() {
-	for {
-		task, found := getNextTaskToProcess()
-		if found {
-			processTask(task)
-		} else {
-			log.Println("Задач нет в очереди, агент ожидает...")
-			time.Sleep(1 * time.Second) // Пауза, если задач нет
+		if err := a.store.EnqueueTask(task); err != nil {
+			return fmt.Errorf("не удалось вернуть задачу %s в очередь: %v", task.ID, err)
 		}
+		queued[task.ID] = true
+		taskQueueDepth.Inc()
+		notifyTaskAvailable()
+		restored++
 	}
+
+	orphaned := 0
+	for id, task := range tasks {
+		if queued[id] || task.Status == "completed" || len(task.DependsOn) > 0 {
+			continue
+		}
+		// Задача без незавершённых зависимостей, но не найденная в очереди, —
+		// была выдана агенту и не подтверждена до перезапуска. Возвращаем её
+		// в очередь, как истекшая аренда вернула бы в expireLease.
+		task.Status = "pending"
+		if err := a.store.EnqueueTask(task); err != nil {
+			return fmt.Errorf("не удалось вернуть оборванную задачу %s в очередь: %v", id, err)
+		}
+		taskQueueDepth.Inc()
+		notifyTaskAvailable()
+		orphaned++
+	}
+
+	if len(loaded) > 0 || len(tasks) > 0 {
+		logger.Info("восстановлено из хранилища", "expressions", len(loaded), "tasks", len(tasks), "queued_tasks", restored, "orphaned_tasks", orphaned)
+	}
+	return nil
 }
 
 // Функция запуска приложения
 func (a *Application) RunServer() error {
-	r := mux.NewRouter()
-
-	r.HandleFunc("/api/v1/calculate", AddExpressionHandler).Methods("POST")
-	r.HandleFunc("/api/v1/expressions", GetExpressionsHandler).Methods("GET")
-	r.HandleFunc("/api/v1/expressions/{id}", GetExpressionByIDHandler).Methods("GET")
-	r.HandleFunc("/internal/task", GetTaskHandler).Methods("GET")
+	if err := a.rehydrate(); err != nil {
+		return err
+	}
 
-	go startAgent() // Запуск агента в отдельной горутине
+	r := mux.NewRouter()
+	r.Use(metricsMiddleware)
+
+	r.HandleFunc("/api/v1/calculate", a.AddExpressionHandler).Methods("POST").Name("calculate")
+	r.HandleFunc("/api/v1/expressions", GetExpressionsHandler).Methods("GET").Name("expressions")
+	r.HandleFunc("/api/v1/expressions/{id}", GetExpressionByIDHandler).Methods("GET").Name("expression")
+	r.HandleFunc("/api/v1/expressions/{id}/subscribe", a.SubscribeHandler).Methods("GET").Name("expression_subscribe")
+	r.HandleFunc("/internal/task", a.GetTaskHandler).Methods("GET").Name("task_get")
+	r.HandleFunc("/internal/task", a.PostTaskResultHandler).Methods("POST").Name("task_result")
+	r.HandleFunc("/internal/task/{id}/heartbeat", a.HeartbeatHandler).Methods("POST").Name("task_heartbeat")
+	r.Handle("/metrics", promhttp.Handler()).Name("metrics")
+
+	if a.config.GRPCAddr != "" {
+		go func() {
+			if err := a.RunGRPCServer(); err != nil {
+				logger.Error("gRPC-сервер остановлен с ошибкой", "error", err)
+			}
+		}()
+	}
 
-	fmt.Println("Запуск сервера на порту " + a.config.Addr)
+	logger.Info("запуск сервера", "addr", a.config.Addr)
 
 	if err := http.ListenAndServe(":"+a.config.Addr, r); err != nil {
 		log.Fatal("Ошибка при запуске сервера:", err)
 	}
-	return http.ListenAndServe(":"+a.config.Addr, r)
+	return nil
 }
@@ -0,0 +1,178 @@
+package application
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	expressionsBucket = []byte("expressions")
+	tasksBucket       = []byte("tasks")
+	queueBucket       = []byte("queue")
+)
+
+// BoltStore – реализация Store поверх embedded key-value базы BoltDB,
+// используется, когда задан STORAGE_PATH
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore – открывает (или создаёт) BoltDB-файл по указанному пути
+// и готовит необходимые bucket'ы
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть хранилище %q: %v", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{expressionsBucket, tasksBucket, queueBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("не удалось подготовить bucket'ы хранилища %q: %v", path, err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// Close – закрывает файл BoltDB
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStore) SaveExpression(expr *Expression) error {
+	data, err := json.Marshal(expr)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации выражения %s: %v", expr.ID, err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(expressionsBucket).Put([]byte(expr.ID), data)
+	})
+}
+
+func (s *BoltStore) LoadExpressions() (map[string]*Expression, error) {
+	result := make(map[string]*Expression)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(expressionsBucket).ForEach(func(k, v []byte) error {
+			var expr Expression
+			if err := json.Unmarshal(v, &expr); err != nil {
+				return fmt.Errorf("ошибка десериализации выражения %s: %v", k, err)
+			}
+			result[expr.ID] = &expr
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *BoltStore) EnqueueTask(task *Task) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации задачи %s: %v", task.ID, err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(tasksBucket).Put([]byte(task.ID), data); err != nil {
+			return err
+		}
+
+		queue := tx.Bucket(queueBucket)
+		seq, err := queue.NextSequence()
+		if err != nil {
+			return err
+		}
+		return queue.Put(sequenceKey(seq), []byte(task.ID))
+	})
+}
+
+func (s *BoltStore) SaveTask(task *Task) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации задачи %s: %v", task.ID, err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tasksBucket).Put([]byte(task.ID), data)
+	})
+}
+
+func (s *BoltStore) LoadTasks() (map[string]*Task, error) {
+	result := make(map[string]*Task)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tasksBucket).ForEach(func(k, v []byte) error {
+			var task Task
+			if err := json.Unmarshal(v, &task); err != nil {
+				return fmt.Errorf("ошибка десериализации задачи %s: %v", k, err)
+			}
+			result[task.ID] = &task
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *BoltStore) DequeueTask() (*Task, error) {
+	var task *Task
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		queue := tx.Bucket(queueBucket)
+		tasks := tx.Bucket(tasksBucket)
+		c := queue.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			taskID := v
+			if err := queue.Delete(k); err != nil {
+				return err
+			}
+
+			data := tasks.Get(taskID)
+			if data == nil {
+				// Задача уже была подтверждена (AckTask) — эта запись в очереди устарела, пропускаем
+				continue
+			}
+
+			var t Task
+			if err := json.Unmarshal(data, &t); err != nil {
+				return fmt.Errorf("ошибка десериализации задачи %s: %v", taskID, err)
+			}
+			task = &t
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+func (s *BoltStore) AckTask(taskID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tasksBucket).Delete([]byte(taskID))
+	})
+}
+
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
@@ -0,0 +1,110 @@
+package application
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/Powdersumm/andexlmscalcproject2sprint/internal/application/agentpb"
+)
+
+// grpcTaskPollInterval – на случай пропущенного сигнала notifyTaskAvailable
+// (например, из-за гонки между Stream и выдачей задачи) стрим всё равно
+// периодически перепроверяет очередь, не дожидаясь его бесконечно.
+const grpcTaskPollInterval = time.Second
+
+// agentServer – реализация agentpb.AgentServiceServer поверх общей с HTTP
+// очереди задач: Stream обслуживает один подключённый воркер агента за раз.
+type agentServer struct {
+	agentpb.UnimplementedAgentServiceServer
+	app *Application
+}
+
+// RunGRPCServer – поднимает gRPC-сервер AgentService на config.GRPCAddr,
+// альтернативный HTTP-транспорт для агентов, работающий поверх того же
+// хранилища и той же очереди задач, что и /internal/task.
+func (a *Application) RunGRPCServer() error {
+	lis, err := net.Listen("tcp", a.config.GRPCAddr)
+	if err != nil {
+		return err
+	}
+
+	server := grpc.NewServer()
+	agentpb.RegisterAgentServiceServer(server, &agentServer{app: a})
+
+	logger.Info("запуск gRPC-сервера", "addr", a.config.GRPCAddr)
+	return server.Serve(lis)
+}
+
+// Stream – обслуживает одного подключённого агента: на каждое AgentMessage
+// (сигнал готовности или результат предыдущей задачи) отвечает очередной
+// готовой задачей, дожидаясь её появления в очереди через taskAvailable.
+func (s *agentServer) Stream(stream agentpb.AgentService_StreamServer) error {
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		if result := msg.GetResult(); result != nil {
+			if err := s.app.submitTaskResult(TaskResult{
+				ID:     result.GetId(),
+				Result: result.GetResult(),
+				Error:  result.GetError(),
+			}); err != nil {
+				logger.Error("не удалось принять результат задачи по gRPC", "task_id", result.GetId(), "error", err)
+			}
+		}
+
+		task, err := s.nextTask(stream.Context())
+		if err != nil {
+			return err
+		}
+		if task == nil {
+			// Поток агента закрыт (stream.Context().Done()), завершаем обработку.
+			return stream.Context().Err()
+		}
+
+		if err := stream.Send(&agentpb.OrchestratorMessage{
+			Payload: &agentpb.OrchestratorMessage_Task{Task: &agentpb.Task{
+				Id:              task.ID,
+				Arg1:            task.Arg1,
+				Arg2:            task.Arg2,
+				Operation:       task.Operation,
+				OperationTimeMs: task.OperationTime,
+			}},
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// nextTask – ждёт появления готовой задачи в очереди, не опрашивая её по таймеру:
+// сперва пробует сразу, затем блокируется на taskAvailable.wait() (или периодическом
+// подстраховочном тике), пока задача не появится либо поток агента не закроется.
+// taskAvailable будит этим способом сразу все простаивающие стримы, а не только
+// один — иначе при нескольких свободных агентах все, кроме одного, откатились бы
+// к ticker.C и получали задачу с задержкой до секунды.
+func (s *agentServer) nextTask(ctx context.Context) (*Task, error) {
+	ticker := time.NewTicker(grpcTaskPollInterval)
+	defer ticker.Stop()
+
+	for {
+		task, err := s.app.dispatchTask()
+		if err != nil {
+			return nil, err
+		}
+		if task != nil {
+			return task, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case <-taskAvailable.wait():
+		case <-ticker.C:
+		}
+	}
+}
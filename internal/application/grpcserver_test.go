@@ -0,0 +1,167 @@
+package application
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/Powdersumm/andexlmscalcproject2sprint/internal/application/agentpb"
+)
+
+// newBufconnAgentClient поднимает agentServer поверх in-memory bufconn-слушателя
+// и возвращает уже открытый стрим AgentService, как если бы настоящий агент
+// подключился к оркестратору по сети.
+func newBufconnAgentClient(t *testing.T, app *Application) agentpb.AgentService_StreamClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	agentpb.RegisterAgentServiceServer(server, &agentServer{app: app})
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial bufconn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	client := agentpb.NewAgentServiceClient(conn)
+	stream, err := client.Stream(context.Background())
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	return stream
+}
+
+func TestGRPCStreamDispatchesAndAcceptsResult(t *testing.T) {
+	expressions = make(map[string]*Expression)
+	tasksByID = make(map[string]*Task)
+	inFlight = make(map[string]*taskLease)
+
+	cfg := &Config{TaskLeaseMS: 5000, TaskMaxAttempts: 3}
+	app := &Application{config: cfg, store: NewMemoryStore()}
+
+	rootID, _, isLiteral, err := decomposeExpression(app.config, app.store, "expr-grpc", "1+2")
+	if err != nil {
+		t.Fatalf("decomposeExpression failed: %v", err)
+	}
+	if isLiteral {
+		t.Fatal("expected a task graph, got a literal")
+	}
+	expressionsMutex.Lock()
+	expressions["expr-grpc"] = &Expression{ID: "expr-grpc", Expression: "1+2", Status: "pending", RootTaskID: rootID}
+	expressionsMutex.Unlock()
+
+	stream := newBufconnAgentClient(t, app)
+
+	if err := stream.Send(&agentpb.AgentMessage{Payload: &agentpb.AgentMessage_Ready{Ready: true}}); err != nil {
+		t.Fatalf("failed to send ready: %v", err)
+	}
+
+	msg, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("failed to receive task: %v", err)
+	}
+	task := msg.GetTask()
+	if task == nil {
+		t.Fatal("expected a task, got nil")
+	}
+	if task.GetArg1() != 1 || task.GetArg2() != 2 || task.GetOperation() != "+" {
+		t.Fatalf("unexpected task: %+v", task)
+	}
+
+	if err := stream.Send(&agentpb.AgentMessage{Payload: &agentpb.AgentMessage_Result{
+		Result: &agentpb.TaskResult{Id: task.GetId(), Result: 3},
+	}}); err != nil {
+		t.Fatalf("failed to send result: %v", err)
+	}
+
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case <-deadline:
+			t.Fatal("expression did not complete in time")
+		default:
+		}
+
+		expressionsMutex.Lock()
+		expr := expressions["expr-grpc"]
+		var status string
+		var result float64
+		if expr != nil {
+			status, result = expr.Status, expr.Result
+		}
+		expressionsMutex.Unlock()
+
+		if status == "completed" {
+			if result != 3 {
+				t.Fatalf("expected result 3, got %v", result)
+			}
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestGRPCStreamWakesAllIdleAgents проверяет, что появление готовой задачи
+// будит сразу всех простаивающих агентов, а не только одного: иначе вторая из
+// двух одновременно подключённых задач ждала бы до grpcTaskPollInterval.
+func TestGRPCStreamWakesAllIdleAgents(t *testing.T) {
+	expressions = make(map[string]*Expression)
+	tasksByID = make(map[string]*Task)
+	inFlight = make(map[string]*taskLease)
+
+	cfg := &Config{TaskLeaseMS: 5000, TaskMaxAttempts: 3}
+	app := &Application{config: cfg, store: NewMemoryStore()}
+
+	const agents = 2
+	streams := make([]agentpb.AgentService_StreamClient, agents)
+	for i := range streams {
+		streams[i] = newBufconnAgentClient(t, app)
+		if err := streams[i].Send(&agentpb.AgentMessage{Payload: &agentpb.AgentMessage_Ready{Ready: true}}); err != nil {
+			t.Fatalf("agent %d: failed to send ready: %v", i, err)
+		}
+	}
+
+	// Обе задачи ставятся в очередь разом — каждый простаивающий агент должен
+	// получить свою без ожидания ticker-а.
+	for i := 0; i < agents; i++ {
+		exprID := "expr-fanout-" + strconv.Itoa(i)
+		if _, _, isLiteral, err := decomposeExpression(app.config, app.store, exprID, "1+2"); err != nil {
+			t.Fatalf("decomposeExpression failed: %v", err)
+		} else if isLiteral {
+			t.Fatal("expected a task graph, got a literal")
+		}
+	}
+
+	recv := make(chan struct{}, agents)
+	for _, s := range streams {
+		s := s
+		go func() {
+			if _, err := s.Recv(); err == nil {
+				recv <- struct{}{}
+			}
+		}()
+	}
+
+	timeout := time.After(grpcTaskPollInterval - 100*time.Millisecond)
+	for i := 0; i < agents; i++ {
+		select {
+		case <-recv:
+		case <-timeout:
+			t.Fatal("not all idle agents were woken before the fallback poll tick")
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package application
+
+import "sync"
+
+// Event – событие, отправляемое подписчикам выражения через SSE
+type Event struct {
+	Event  string  `json:"event"`
+	TaskID string  `json:"task_id,omitempty"`
+	Result float64 `json:"result,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// subscriberBuffer – размер буфера канала одного подписчика. Если подписчик
+// не успевает вычитывать события, новые события для него отбрасываются
+// (drop-slow-consumer), чтобы медленный клиент не блокировал публикацию остальным.
+const subscriberBuffer = 16
+
+// hub – pub/sub для событий выражений, подписчики сгруппированы по ID выражения
+type hub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan Event]struct{}
+}
+
+func newHub() *hub {
+	return &hub{subscribers: make(map[string]map[chan Event]struct{})}
+}
+
+var subscriptionHub = newHub()
+
+// Subscribe – регистрирует нового подписчика на события выражения expressionID.
+// Возвращает канал событий и функцию отписки, которую нужно вызвать по завершении работы с каналом.
+func (h *hub) Subscribe(expressionID string) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[expressionID] == nil {
+		h.subscribers[expressionID] = make(map[chan Event]struct{})
+	}
+	h.subscribers[expressionID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		delete(h.subscribers[expressionID], ch)
+		if len(h.subscribers[expressionID]) == 0 {
+			delete(h.subscribers, expressionID)
+		}
+		h.mu.Unlock()
+	}
+
+	return ch, unsubscribe
+}
+
+// Publish – рассылает событие всем подписчикам выражения expressionID.
+// Подписчику, не успевающему вычитывать канал, событие не доставляется.
+func (h *hub) Publish(expressionID string, event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[expressionID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package application
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func newTestServer(cfg *Config) (*Application, *httptest.Server) {
+	expressions = make(map[string]*Expression)
+	tasksByID = make(map[string]*Task)
+	inFlight = make(map[string]*taskLease)
+
+	app := &Application{config: cfg, store: NewMemoryStore()}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/calculate", app.AddExpressionHandler).Methods("POST")
+	r.HandleFunc("/api/v1/expressions/{id}", GetExpressionByIDHandler).Methods("GET")
+	r.HandleFunc("/api/v1/expressions/{id}/subscribe", app.SubscribeHandler).Methods("GET")
+	r.HandleFunc("/internal/task", app.GetTaskHandler).Methods("GET")
+	r.HandleFunc("/internal/task", app.PostTaskResultHandler).Methods("POST")
+	r.HandleFunc("/internal/task/{id}/heartbeat", app.HeartbeatHandler).Methods("POST")
+
+	return app, httptest.NewServer(r)
+}
+
+func pullTask(t *testing.T, baseURL string) Task {
+	t.Helper()
+	resp, err := http.Get(baseURL + "/internal/task")
+	if err != nil {
+		t.Fatalf("failed to pull task: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var task Task
+	json.NewDecoder(resp.Body).Decode(&task)
+	return task
+}
+
+func TestExpiredLeaseReturnsTaskToQueue(t *testing.T) {
+	cfg := &Config{TaskLeaseMS: 30, TaskMaxAttempts: 5}
+	_, server := newTestServer(cfg)
+	defer server.Close()
+
+	body, _ := json.Marshal(Request{Expression: "1+2"})
+	resp, _ := http.Post(server.URL+"/api/v1/calculate", "application/json", bytes.NewReader(body))
+	resp.Body.Close()
+
+	first := pullTask(t, server.URL)
+	if first.Attempts != 1 {
+		t.Fatalf("expected attempts=1 after first dispatch, got %d", first.Attempts)
+	}
+
+	// Не шлём результат — ждём, пока аренда истечёт и задача вернётся в очередь.
+	time.Sleep(100 * time.Millisecond)
+
+	second := pullTask(t, server.URL)
+	if second.ID != first.ID {
+		t.Fatalf("expected the same task to be redispatched, got %s vs %s", second.ID, first.ID)
+	}
+	if second.Attempts != 2 {
+		t.Fatalf("expected attempts=2 after requeue, got %d", second.Attempts)
+	}
+
+	payload, _ := json.Marshal(TaskResult{ID: second.ID, Result: 3})
+	resp, err := http.Post(server.URL+"/internal/task", "application/json", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("failed to post result: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 posting result, got %d", resp.StatusCode)
+	}
+}
+
+func TestHeartbeatExtendsLease(t *testing.T) {
+	cfg := &Config{TaskLeaseMS: 60, TaskMaxAttempts: 5}
+	_, server := newTestServer(cfg)
+	defer server.Close()
+
+	body, _ := json.Marshal(Request{Expression: "1+2"})
+	resp, _ := http.Post(server.URL+"/api/v1/calculate", "application/json", bytes.NewReader(body))
+	resp.Body.Close()
+
+	task := pullTask(t, server.URL)
+
+	// Продлеваем аренду несколько раз дольше исходного таймаута.
+	for i := 0; i < 3; i++ {
+		time.Sleep(30 * time.Millisecond)
+		hbResp, err := http.Post(server.URL+"/internal/task/"+task.ID+"/heartbeat", "application/json", nil)
+		if err != nil {
+			t.Fatalf("heartbeat request failed: %v", err)
+		}
+		hbResp.Body.Close()
+		if hbResp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200 from heartbeat, got %d", hbResp.StatusCode)
+		}
+	}
+
+	payload, _ := json.Marshal(TaskResult{ID: task.ID, Result: 3})
+	resultResp, err := http.Post(server.URL+"/internal/task", "application/json", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("failed to post result: %v", err)
+	}
+	defer resultResp.Body.Close()
+	if resultResp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 posting result after heartbeats, got %d (lease must not have expired)", resultResp.StatusCode)
+	}
+}
+
+func TestTaskFailsExpressionAfterMaxAttempts(t *testing.T) {
+	cfg := &Config{TaskLeaseMS: 20, TaskMaxAttempts: 1}
+	_, server := newTestServer(cfg)
+	defer server.Close()
+
+	body, _ := json.Marshal(Request{Expression: "1+2"})
+	resp, err := http.Post(server.URL+"/api/v1/calculate", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("calculate request failed: %v", err)
+	}
+	var created map[string]string
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+
+	pullTask(t, server.URL) // забираем, но не подтверждаем — аренда истечёт и исчерпает лимит попыток
+
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case <-deadline:
+			t.Fatal("expression did not fail in time")
+		default:
+		}
+
+		resp, err := http.Get(server.URL + "/api/v1/expressions/" + created["id"])
+		if err == nil {
+			var expr Expression
+			json.NewDecoder(resp.Body).Decode(&expr)
+			resp.Body.Close()
+			if expr.Status == "failed" {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRehydrateDoesNotResurrectFailedExpressionTasks(t *testing.T) {
+	cfg := &Config{TaskLeaseMS: 20, TaskMaxAttempts: 1}
+	app, server := newTestServer(cfg)
+	defer server.Close()
+
+	body, _ := json.Marshal(Request{Expression: "1+2"})
+	resp, err := http.Post(server.URL+"/api/v1/calculate", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("calculate request failed: %v", err)
+	}
+	var created map[string]string
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+
+	pullTask(t, server.URL) // забираем, но не подтверждаем — аренда истечёт и исчерпает лимит попыток
+
+	deadline := time.After(2 * time.Second)
+	for {
+		expr := getExpression(t, server.URL, created["id"])
+		if expr.Status == "failed" {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("expression did not fail in time")
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Новый Application на том же хранилище — так выглядит перезапуск оркестратора
+	rehydrated := &Application{config: cfg, store: app.store}
+	if err := rehydrated.rehydrate(); err != nil {
+		t.Fatalf("rehydrate failed: %v", err)
+	}
+
+	task, err := rehydrated.dispatchTask()
+	if err != nil {
+		t.Fatalf("unexpected error dispatching after rehydrate: %v", err)
+	}
+	if task != nil {
+		t.Fatalf("expected no task to survive a failed expression across rehydrate, got %+v", task)
+	}
+
+	expr := getExpression(t, server.URL, created["id"])
+	if expr.Status != "failed" {
+		t.Fatalf("expected expression to remain failed after rehydrate, got %q", expr.Status)
+	}
+}
+
+func getExpression(t *testing.T, baseURL, id string) Expression {
+	t.Helper()
+	resp, err := http.Get(baseURL + "/api/v1/expressions/" + id)
+	if err != nil {
+		t.Fatalf("failed to get expression: %v", err)
+	}
+	defer resp.Body.Close()
+	var expr Expression
+	json.NewDecoder(resp.Body).Decode(&expr)
+	return expr
+}
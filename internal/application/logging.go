@@ -0,0 +1,10 @@
+package application
+
+import (
+	"log/slog"
+	"os"
+)
+
+// logger – структурированный логгер оркестратора. По умолчанию пишет в stdout
+// в текстовом формате; достаточно для текущего масштаба проекта.
+var logger = slog.New(slog.NewTextHandler(os.Stdout, nil))
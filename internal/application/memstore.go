@@ -0,0 +1,105 @@
+package application
+
+import "sync"
+
+// MemoryStore – реализация Store в памяти процесса, без персистентности.
+// Используется по умолчанию, если STORAGE_PATH не задан, а также в тестах.
+type MemoryStore struct {
+	mu          sync.Mutex
+	expressions map[string]*Expression
+	queue       []string
+	queued      map[string]bool
+	tasks       map[string]*Task
+}
+
+// NewMemoryStore – создание нового пустого MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		expressions: make(map[string]*Expression),
+		queued:      make(map[string]bool),
+		tasks:       make(map[string]*Task),
+	}
+}
+
+func (s *MemoryStore) SaveExpression(expr *Expression) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *expr
+	s.expressions[expr.ID] = &saved
+	return nil
+}
+
+func (s *MemoryStore) LoadExpressions() (map[string]*Expression, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make(map[string]*Expression, len(s.expressions))
+	for id, expr := range s.expressions {
+		copied := *expr
+		result[id] = &copied
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) EnqueueTask(task *Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *task
+	s.tasks[task.ID] = &saved
+	// s.queued, а не присутствие в s.tasks, отслеживает, стоит ли задача в очереди
+	// сейчас: s.tasks также хранит выданные агенту (но ещё не подтверждённые) задачи,
+	// и повторный EnqueueTask той же задачи (ретрай по истечении аренды, родитель
+	// стал готов) должен снова поставить её в очередь.
+	if !s.queued[task.ID] {
+		s.queue = append(s.queue, task.ID)
+		s.queued[task.ID] = true
+	}
+	return nil
+}
+
+func (s *MemoryStore) SaveTask(task *Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *task
+	s.tasks[task.ID] = &saved
+	return nil
+}
+
+func (s *MemoryStore) LoadTasks() (map[string]*Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make(map[string]*Task, len(s.tasks))
+	for id, task := range s.tasks {
+		copied := *task
+		result[id] = &copied
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) DequeueTask() (*Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.queue) > 0 {
+		id := s.queue[0]
+		s.queue = s.queue[1:]
+		delete(s.queued, id)
+		if task, ok := s.tasks[id]; ok {
+			copied := *task
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *MemoryStore) AckTask(taskID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.tasks, taskID)
+	return nil
+}
@@ -0,0 +1,93 @@
+package application
+
+import "testing"
+
+func TestMemoryStoreExpressionRoundTrip(t *testing.T) {
+	store := NewMemoryStore()
+
+	if err := store.SaveExpression(&Expression{ID: "expr-1", Expression: "1+2", Status: "pending"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	loaded, err := store.LoadExpressions()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loaded["expr-1"].Status != "pending" {
+		t.Fatalf("expected pending status, got %q", loaded["expr-1"].Status)
+	}
+
+	// Мутация возвращённой копии не должна влиять на хранилище
+	loaded["expr-1"].Status = "completed"
+	reloaded, _ := store.LoadExpressions()
+	if reloaded["expr-1"].Status != "pending" {
+		t.Fatalf("store should not be affected by mutations of a loaded copy")
+	}
+}
+
+func TestMemoryStoreTaskQueueRoundTrip(t *testing.T) {
+	store := NewMemoryStore()
+
+	task := &Task{ID: "task-1", Operation: "+", Arg1: 1, Arg2: 2, Status: "pending"}
+	if err := store.EnqueueTask(task); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dequeued, err := store.DequeueTask()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dequeued == nil || dequeued.ID != "task-1" {
+		t.Fatalf("expected to dequeue task-1, got %+v", dequeued)
+	}
+
+	empty, err := store.DequeueTask()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if empty != nil {
+		t.Fatalf("expected nil after draining the queue, got %+v", empty)
+	}
+
+	// Задачу можно вернуть в очередь повторно (например, после истечения аренды)
+	if err := store.EnqueueTask(dequeued); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	requeued, _ := store.DequeueTask()
+	if requeued == nil || requeued.ID != "task-1" {
+		t.Fatalf("expected task-1 to be requeued, got %+v", requeued)
+	}
+
+	if err := store.AckTask("task-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.EnqueueTask(requeued); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestMemoryStoreSaveTaskDoesNotTouchQueue(t *testing.T) {
+	store := NewMemoryStore()
+
+	blocked := &Task{ID: "task-parent", Operation: "+", DependsOn: []string{"task-child"}, Status: "pending"}
+	if err := store.SaveTask(blocked); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// SaveTask не ставит задачу в очередь готовых — она всё ещё ждёт зависимостей
+	empty, err := store.DequeueTask()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if empty != nil {
+		t.Fatalf("expected blocked task to stay out of the ready queue, got %+v", empty)
+	}
+
+	loaded, err := store.LoadTasks()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loaded["task-parent"] == nil || loaded["task-parent"].Status != "pending" {
+		t.Fatalf("expected task-parent to be loadable via LoadTasks, got %+v", loaded["task-parent"])
+	}
+}
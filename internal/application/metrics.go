@@ -0,0 +1,95 @@
+package application
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	expressionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "calc_expressions_total",
+		Help: "Количество выражений по итоговому статусу",
+	}, []string{"status"})
+
+	tasksDispatchedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "calc_tasks_dispatched_total",
+		Help: "Количество задач, выданных агентам, по операции",
+	}, []string{"op"})
+
+	tasksCompletedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "calc_tasks_completed_total",
+		Help: "Количество завершённых задач по операции и результату",
+	}, []string{"op", "result"})
+
+	taskDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "calc_task_duration_seconds",
+		Help: "Время выполнения задачи агентом — от выдачи до присылки результата",
+	}, []string{"op"})
+
+	taskQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "calc_task_queue_depth",
+		Help: "Текущая глубина очереди готовых к выполнению задач",
+	})
+
+	taskRetriesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "calc_task_retries_total",
+		Help: "Количество повторных постановок задач в очередь после истечения аренды",
+	})
+
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "calc_http_requests_total",
+		Help: "Количество HTTP-запросов по маршруту, методу и статусу ответа",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "calc_http_request_duration_seconds",
+		Help: "Длительность обработки HTTP-запроса по маршруту и методу",
+	}, []string{"route", "method"})
+)
+
+// metricsMiddleware – middleware для mux.Router, записывающее латентность
+// и статус каждого HTTP-запроса по маршруту
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		route := routeLabel(r)
+		httpRequestsTotal.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		httpRequestDurationSeconds.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// routeLabel – имя маршрута для метки метрики: имя именованного маршрута mux,
+// иначе его шаблон пути, иначе фактический путь запроса
+func routeLabel(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return r.URL.Path
+	}
+	if name := route.GetName(); name != "" {
+		return name
+	}
+	if tmpl, err := route.GetPathTemplate(); err == nil {
+		return tmpl
+	}
+	return r.URL.Path
+}
+
+// statusRecorder – оборачивает http.ResponseWriter, чтобы запомнить итоговый статус ответа
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
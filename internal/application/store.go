@@ -0,0 +1,30 @@
+package application
+
+// Store – хранилище выражений и всего графа их задач, чтобы перезапуск
+// оркестратора не терял уже проделанную или поставленную в очередь работу.
+//
+// Персистентности подлежат сами Expression и весь граф задач выражения,
+// включая ещё не готовые (ожидающие зависимостей) и уже выданные агенту —
+// SaveTask обновляет состояние задачи, не трогая очередь, а EnqueueTask
+// дополнительно кладёт её в очередь готовых к выполнению. Так при рехидратации
+// (см. Application.rehydrate) восстанавливается не только очередь, но и
+// родительские задачи, на которые ссылаются DependsOn/ParentID ещё не
+// завершённых детей.
+type Store interface {
+	// SaveExpression сохраняет текущее состояние выражения (создаёт или обновляет запись)
+	SaveExpression(expr *Expression) error
+	// LoadExpressions возвращает все сохранённые выражения, ключ — их ID
+	LoadExpressions() (map[string]*Expression, error)
+	// SaveTask сохраняет текущее состояние задачи (листовой, блокированной зависимостями
+	// или уже выданной агенту), не изменяя её положение в очереди готовых к выполнению
+	SaveTask(task *Task) error
+	// LoadTasks возвращает все ещё не подтверждённые (не Ack'нутые) задачи, ключ — их ID
+	LoadTasks() (map[string]*Task, error)
+	// EnqueueTask сохраняет задачу и ставит её в очередь готовых к выполнению
+	// (или возвращает её туда же после сброса аренды)
+	EnqueueTask(task *Task) error
+	// DequeueTask забирает следующую готовую задачу из очереди; возвращает (nil, nil), если очередь пуста
+	DequeueTask() (*Task, error)
+	// AckTask убирает задачу насовсем — агент прислал результат, она больше не нужна
+	AckTask(taskID string) error
+}
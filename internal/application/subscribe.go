@@ -0,0 +1,89 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// SubscribeHandler – обработчик GET-запроса, открывающий Server-Sent Events
+// соединение и пушащий клиенту события по мере вычисления выражения:
+// task_completed по завершении каждой промежуточной задачи, затем
+// expression_completed или expression_failed по завершении всего выражения.
+func (a *Application) SubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	expressionsMutex.Lock()
+	_, found := expressions[id]
+	expressionsMutex.Unlock()
+	if !found {
+		http.Error(w, "expression not found", http.StatusNotFound)
+		return
+	}
+
+	// Подписываемся до повторного чтения статуса, иначе выражение может
+	// перейти в терминальное состояние в промежутке, и завершающий Publish
+	// будет потерян — подписчик зависнет до отключения клиента вместо того,
+	// чтобы увидеть expression_completed/expression_failed
+	events, unsubscribe := subscriptionHub.Subscribe(id)
+	defer unsubscribe()
+
+	expressionsMutex.Lock()
+	expr, found := expressions[id]
+	var terminal *Event
+	if found {
+		switch expr.Status {
+		case "completed":
+			terminal = &Event{Event: "expression_completed", Result: expr.Result}
+		case "failed":
+			terminal = &Event{Event: "expression_failed", Error: expr.Error}
+		}
+	}
+	expressionsMutex.Unlock()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	if terminal != nil {
+		// Уже терминально на момент подписки: в канале events мог успеть
+		// осесть тот же самый Publish — это безопасно, т.к. мы не читаем
+		// из канала и просто отписываемся через defer, не доставляя событие дважды
+		writeSSEEvent(w, *terminal)
+		flusher.Flush()
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			writeSSEEvent(w, event)
+			flusher.Flush()
+			if event.Event == "expression_completed" || event.Event == "expression_failed" {
+				return
+			}
+		}
+	}
+}
+
+// writeSSEEvent – сериализует событие в формат Server-Sent Events
+func writeSSEEvent(w http.ResponseWriter, event Event) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("не удалось сериализовать событие подписки", "error", err)
+		return
+	}
+	fmt.Fprintf(w, "data: %s\n\n", payload)
+}
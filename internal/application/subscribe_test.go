@@ -0,0 +1,96 @@
+package application
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readSSEEvents – читает события из потока SSE и отправляет их в канал до закрытия тела ответа
+func readSSEEvents(t *testing.T, body *http.Response) chan Event {
+	events := make(chan Event, 10)
+	go func() {
+		defer close(events)
+		defer body.Body.Close()
+		scanner := bufio.NewScanner(body.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				t.Errorf("failed to decode SSE event: %v", err)
+				return
+			}
+			events <- event
+		}
+	}()
+	return events
+}
+
+func nextEvent(t *testing.T, events chan Event) Event {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("event stream closed before expected event")
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for SSE event")
+		return Event{}
+	}
+}
+
+func TestSubscribeReceivesTaskAndExpressionEvents(t *testing.T) {
+	cfg := &Config{TaskLeaseMS: 5000, TaskMaxAttempts: 3}
+	_, server := newTestServer(cfg)
+	defer server.Close()
+
+	body, _ := json.Marshal(Request{Expression: "1+2+3"})
+	resp, err := http.Post(server.URL+"/api/v1/calculate", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("calculate request failed: %v", err)
+	}
+	var created map[string]string
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+
+	subResp, err := http.Get(server.URL + "/api/v1/expressions/" + created["id"] + "/subscribe")
+	if err != nil {
+		t.Fatalf("subscribe request failed: %v", err)
+	}
+	events := readSSEEvents(t, subResp)
+
+	// Завершаем первую (листовую) задачу — 1+2
+	first := pullTask(t, server.URL)
+	resultPayload, _ := json.Marshal(TaskResult{ID: first.ID, Result: 3})
+	resultResp, _ := http.Post(server.URL+"/internal/task", "application/json", bytes.NewReader(resultPayload))
+	resultResp.Body.Close()
+
+	event := nextEvent(t, events)
+	if event.Event != "task_completed" || event.TaskID != first.ID || event.Result != 3 {
+		t.Fatalf("unexpected first event: %+v", event)
+	}
+
+	// Завершаем корневую задачу — (1+2)+3
+	second := pullTask(t, server.URL)
+	resultPayload, _ = json.Marshal(TaskResult{ID: second.ID, Result: 6})
+	resultResp, _ = http.Post(server.URL+"/internal/task", "application/json", bytes.NewReader(resultPayload))
+	resultResp.Body.Close()
+
+	event = nextEvent(t, events)
+	if event.Event != "task_completed" || event.TaskID != second.ID || event.Result != 6 {
+		t.Fatalf("unexpected second event: %+v", event)
+	}
+
+	event = nextEvent(t, events)
+	if event.Event != "expression_completed" || event.Result != 6 {
+		t.Fatalf("unexpected third event: %+v", event)
+	}
+}
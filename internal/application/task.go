@@ -0,0 +1,589 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Task – структура задачи для вычисления одной бинарной операции
+type Task struct {
+	ID            string   `json:"id"`
+	ExpressionID  string   `json:"-"`
+	Arg1          float64  `json:"arg1"`
+	Arg2          float64  `json:"arg2"`
+	Operation     string   `json:"operation"`
+	OperationTime int64    `json:"operation_time"`
+	DependsOn     []string `json:"depends_on,omitempty"`
+	Status        string   `json:"status"`
+	Attempts      int      `json:"attempts"`
+
+	// ParentID/ParentSlot указывают, в какую задачу и в какой аргумент (1 или 2)
+	// подставить результат этой задачи после её завершения. Пусто для корневой задачи.
+	// Экспортированы, чтобы переживать сериализацию в Store.
+	ParentID   string `json:"parent_id,omitempty"`
+	ParentSlot int    `json:"parent_slot,omitempty"`
+}
+
+// taskLease – аренда задачи, выданной агенту: пока она активна, задача не
+// возвращается в очередь. taskLease.timer возвращает задачу в очередь
+// по истечении TaskLeaseMS (или 2*OperationTime), если агент не прислал ни
+// результат, ни heartbeat.
+type taskLease struct {
+	timer     *time.Timer
+	cancel    chan struct{}
+	startedAt time.Time
+}
+
+var inFlightMutex = &sync.Mutex{}
+var inFlight = make(map[string]*taskLease)
+
+// leaseDuration – длительность аренды задачи: настроенная через TASK_LEASE_MS
+// или, если она не задана, удвоенное время выполнения операции
+func leaseDuration(cfg *Config, task *Task) time.Duration {
+	if cfg.TaskLeaseMS > 0 {
+		return time.Duration(cfg.TaskLeaseMS) * time.Millisecond
+	}
+	return time.Duration(2*task.OperationTime) * time.Millisecond
+}
+
+// startLease – запускает таймер аренды только что выданной задачи
+func startLease(cfg *Config, store Store, task *Task) {
+	lease := &taskLease{cancel: make(chan struct{}), startedAt: time.Now()}
+	lease.timer = time.AfterFunc(leaseDuration(cfg, task), func() {
+		expireLease(cfg, store, task.ID)
+	})
+
+	inFlightMutex.Lock()
+	inFlight[task.ID] = lease
+	inFlightMutex.Unlock()
+}
+
+// stopLease – останавливает таймер аренды при получении результата или heartbeat.
+// Возвращает false, если аренда уже истекла (задача успела уйти другому агенту), и
+// время, прошедшее с момента выдачи задачи — для calc_task_duration_seconds.
+func stopLease(taskID string) (bool, time.Duration) {
+	inFlightMutex.Lock()
+	defer inFlightMutex.Unlock()
+
+	lease, ok := inFlight[taskID]
+	if !ok {
+		return false, 0
+	}
+	lease.timer.Stop()
+	delete(inFlight, taskID)
+	return true, time.Since(lease.startedAt)
+}
+
+// expireLease – срабатывает, когда агент не уложился в аренду: возвращает
+// задачу в очередь для другого агента либо, если попытки исчерпаны,
+// проваливает всё выражение
+func expireLease(cfg *Config, store Store, taskID string) {
+	inFlightMutex.Lock()
+	lease, ok := inFlight[taskID]
+	if !ok {
+		inFlightMutex.Unlock()
+		return
+	}
+	delete(inFlight, taskID)
+	close(lease.cancel)
+	inFlightMutex.Unlock()
+
+	tasksMutex.Lock()
+	task, ok := tasksByID[taskID]
+	if !ok {
+		tasksMutex.Unlock()
+		return
+	}
+	task.Status = "pending"
+	attempts := task.Attempts
+	expressionID := task.ExpressionID
+	tasksMutex.Unlock()
+
+	if attempts >= cfg.TaskMaxAttempts {
+		failExpression(store, expressionID, fmt.Errorf("задача %s превысила лимит попыток (%d)", taskID, cfg.TaskMaxAttempts))
+		return
+	}
+
+	taskRetriesTotal.Inc()
+	logger.Warn("аренда задачи истекла, возвращаем в очередь", "task_id", taskID, "expression_id", expressionID, "attempt", attempts)
+	if err := store.EnqueueTask(task); err != nil {
+		logger.Error("не удалось вернуть задачу в очередь хранилища", "task_id", taskID, "error", err)
+		return
+	}
+	taskQueueDepth.Inc()
+	notifyTaskAvailable()
+}
+
+// failExpression – помечает выражение как не вычисленное и убирает из хранилища
+// все его задачи, чтобы ни одна из них не ожила на rehydrate после перезапуска
+// и не переписала уже наблюдаемый клиентом терминальный статус "failed"
+func failExpression(store Store, expressionID string, cause error) {
+	expressionsMutex.Lock()
+	expr, ok := expressions[expressionID]
+	if ok {
+		expr.Status = "failed"
+		expr.Error = cause.Error()
+	}
+	expressionsMutex.Unlock()
+
+	if ok {
+		if err := store.SaveExpression(expr); err != nil {
+			logger.Error("не удалось сохранить провалившееся выражение", "expression_id", expressionID, "error", err)
+		}
+		expressionsTotal.WithLabelValues(expr.Status).Inc()
+	}
+
+	ackExpressionTasks(store, expressionID)
+
+	subscriptionHub.Publish(expressionID, Event{Event: "expression_failed", Error: cause.Error()})
+	logger.Error("выражение провалено", "expression_id", expressionID, "error", cause)
+}
+
+// ackExpressionTasks – убирает из хранилища (и из памяти процесса) все задачи
+// указанного выражения. Вызывается при провале выражения, чтобы оставшиеся
+// задачи не были ошибочно восстановлены и передиспетчеризованы при rehydrate.
+func ackExpressionTasks(store Store, expressionID string) {
+	tasksMutex.Lock()
+	var ids []string
+	for id, t := range tasksByID {
+		if t.ExpressionID == expressionID {
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range ids {
+		delete(tasksByID, id)
+	}
+	tasksMutex.Unlock()
+
+	for _, id := range ids {
+		if err := store.AckTask(id); err != nil {
+			logger.Error("не удалось убрать задачу провалившегося выражения из хранилища", "task_id", id, "expression_id", expressionID, "error", err)
+		}
+	}
+}
+
+// TaskResult – результат вычисления задачи, присылаемый агентом.
+// Error заполняется агентом, если вычислить задачу не удалось (например, деление на ноль) —
+// в этом случае Result игнорируется и проваливается всё выражение.
+type TaskResult struct {
+	ID     string  `json:"id"`
+	Result float64 `json:"result"`
+	Error  string  `json:"error,omitempty"`
+}
+
+var tasksMutex = &sync.Mutex{}
+var tasksByID = make(map[string]*Task)
+
+// taskAvailableBroadcaster – сигнализирует о появлении задачи в очереди сразу
+// всем ожидающим стримам агентов. Канал с буфером 1 будит только одного из
+// нескольких простаивающих агентов; остальные провисят до подстраховочного
+// тика grpcTaskPollInterval. Здесь же вместо этого закрывается общий канал
+// ожидания — закрытие канала будит всех читателей разом, после чего канал
+// атомарно подменяется на новый для следующего ожидания.
+type taskAvailableBroadcaster struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+func newTaskAvailableBroadcaster() *taskAvailableBroadcaster {
+	return &taskAvailableBroadcaster{ch: make(chan struct{})}
+}
+
+// wait – возвращает канал, который закроется при следующем notify
+func (b *taskAvailableBroadcaster) wait() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.ch
+}
+
+// notify – будит всех, кто сейчас ждёт на wait(), и готовит канал для следующих ожидающих
+func (b *taskAvailableBroadcaster) notify() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	close(b.ch)
+	b.ch = make(chan struct{})
+}
+
+// taskAvailable – используется gRPC-стримом агентов, чтобы ждать новую задачу
+// без опроса очереди по таймеру.
+var taskAvailable = newTaskAvailableBroadcaster()
+
+// notifyTaskAvailable – сигнализирует о появлении задачи в очереди всем ожидающим
+func notifyTaskAvailable() {
+	taskAvailable.notify()
+}
+
+// decomposeExpression – разбирает выражение в AST и раскладывает его на граф задач.
+// Каждая бинарная операция становится отдельной Task; листовые задачи (оба аргумента
+// уже известны) сразу ставятся в очередь хранилища. Если всё выражение сводится
+// к одному литералу, isLiteral возвращается true и граф задач не создаётся.
+func decomposeExpression(cfg *Config, store Store, expressionID, expression string) (rootTaskID string, literal float64, isLiteral bool, err error) {
+	node, err := parser.ParseExpr(expression)
+	if err != nil {
+		return "", 0, false, fmt.Errorf("ошибка при парсинге выражения: %v", err)
+	}
+
+	built := make(map[string]*Task)
+	isLit, value, taskID, err := buildTaskNode(cfg, expressionID, node, built)
+	if err != nil {
+		return "", 0, false, err
+	}
+	if isLit {
+		return "", value, true, nil
+	}
+
+	tasksMutex.Lock()
+	for id, t := range built {
+		tasksByID[id] = t
+	}
+	tasksMutex.Unlock()
+
+	for id, t := range built {
+		if len(t.DependsOn) == 0 {
+			if err := store.EnqueueTask(t); err != nil {
+				return "", 0, false, fmt.Errorf("не удалось поставить задачу %s в очередь: %v", id, err)
+			}
+			taskQueueDepth.Inc()
+			notifyTaskAvailable()
+		} else {
+			// Задача ждёт зависимостей — ещё не готова для очереди, но должна
+			// пережить перезапуск оркестратора, иначе submitTaskResult на рехидратации
+			// не найдёт её по ParentID и результат её последнего ребёнка пропадёт
+			if err := store.SaveTask(t); err != nil {
+				return "", 0, false, fmt.Errorf("не удалось сохранить задачу %s: %v", id, err)
+			}
+		}
+	}
+
+	return taskID, 0, false, nil
+}
+
+// buildTaskNode – рекурсивно обходит AST, создавая Task для каждого ast.BinaryExpr.
+// Возвращает (true, значение, "", nil) для литералов и (false, 0, ID задачи, nil) для подвыражений.
+func buildTaskNode(cfg *Config, expressionID string, node ast.Expr, built map[string]*Task) (bool, float64, string, error) {
+	switch n := node.(type) {
+	case *ast.ParenExpr:
+		return buildTaskNode(cfg, expressionID, n.X, built)
+
+	case *ast.BasicLit:
+		if n.Kind != token.INT && n.Kind != token.FLOAT {
+			return false, 0, "", fmt.Errorf("неподдерживаемый литерал: %s", n.Value)
+		}
+		value, err := strconv.ParseFloat(n.Value, 64)
+		if err != nil {
+			return false, 0, "", fmt.Errorf("ошибка при парсинге числа %q: %v", n.Value, err)
+		}
+		return true, value, "", nil
+
+	case *ast.UnaryExpr:
+		isLit, value, _, err := buildTaskNode(cfg, expressionID, n.X, built)
+		if err != nil {
+			return false, 0, "", err
+		}
+		if !isLit {
+			return false, 0, "", fmt.Errorf("унарный знак поддерживается только для литералов")
+		}
+		switch n.Op {
+		case token.SUB:
+			return true, -value, "", nil
+		case token.ADD:
+			return true, value, "", nil
+		default:
+			return false, 0, "", fmt.Errorf("неподдерживаемая унарная операция: %s", n.Op)
+		}
+
+	case *ast.BinaryExpr:
+		op, opTime, err := operationFor(cfg, n.Op)
+		if err != nil {
+			return false, 0, "", err
+		}
+
+		leftLit, leftVal, leftTaskID, err := buildTaskNode(cfg, expressionID, n.X, built)
+		if err != nil {
+			return false, 0, "", err
+		}
+		rightLit, rightVal, rightTaskID, err := buildTaskNode(cfg, expressionID, n.Y, built)
+		if err != nil {
+			return false, 0, "", err
+		}
+
+		task := &Task{
+			ID:            generateUniqueID(),
+			ExpressionID:  expressionID,
+			Operation:     op,
+			OperationTime: opTime,
+			Status:        "pending",
+		}
+
+		if leftLit {
+			task.Arg1 = leftVal
+		} else {
+			task.DependsOn = append(task.DependsOn, leftTaskID)
+			child := built[leftTaskID]
+			child.ParentID = task.ID
+			child.ParentSlot = 1
+		}
+
+		if rightLit {
+			task.Arg2 = rightVal
+		} else {
+			task.DependsOn = append(task.DependsOn, rightTaskID)
+			child := built[rightTaskID]
+			child.ParentID = task.ID
+			child.ParentSlot = 2
+		}
+
+		built[task.ID] = task
+		return false, 0, task.ID, nil
+
+	default:
+		return false, 0, "", fmt.Errorf("неподдерживаемое выражение: %T", node)
+	}
+}
+
+// operationFor – сопоставляет токен бинарного оператора с его строковым обозначением
+// и настроенной длительностью выполнения
+func operationFor(cfg *Config, op token.Token) (string, int64, error) {
+	switch op {
+	case token.ADD:
+		return "+", cfg.TimeAdditionMS, nil
+	case token.SUB:
+		return "-", cfg.TimeSubtractionMS, nil
+	case token.MUL:
+		return "*", cfg.TimeMultiplicationMS, nil
+	case token.QUO:
+		return "/", cfg.TimeDivisionMS, nil
+	default:
+		return "", 0, fmt.Errorf("неподдерживаемая операция: %s", op)
+	}
+}
+
+// dispatchTask – достаёт из очереди хранилища следующую готовую задачу, выдаёт ей
+// аренду и помечает как выполняемую. Используется как HTTP-обработчиком
+// GetTaskHandler, так и стримом gRPC AgentService — оба транспорта разбирают
+// одну и ту же очередь.
+func (a *Application) dispatchTask() (*Task, error) {
+	task, err := a.store.DequeueTask()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось получить задачу из хранилища: %v", err)
+	}
+	if task == nil {
+		return nil, nil
+	}
+
+	task.Status = "in_progress"
+	task.Attempts++
+
+	// tasksByID хранит отдельную копию: task, возвращаемый вызывающей стороне
+	// (JSON-кодируется в GetTaskHandler / читается стримом gRPC), не должен
+	// делить память с записью, которую позже конкурентно мутируют expireLease
+	// и submitTaskResult
+	tasksMutex.Lock()
+	stored := *task
+	tasksByID[task.ID] = &stored
+	tasksMutex.Unlock()
+
+	startLease(a.config, a.store, task)
+	taskQueueDepth.Dec()
+	tasksDispatchedTotal.WithLabelValues(task.Operation).Inc()
+	logger.Info("задача выдана агенту", "task_id", task.ID, "expression_id", task.ExpressionID, "operation", task.Operation, "attempt", task.Attempts)
+
+	return task, nil
+}
+
+// GetTaskHandler – обработчик GET-запроса, выдающий агенту следующую готовую задачу.
+// Выданная задача получает аренду: если результат не придёт вовремя, она
+// вернётся в очередь для другого агента.
+func (a *Application) GetTaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, err := a.dispatchTask()
+	if err != nil {
+		http.Error(w, "failed to dequeue task", http.StatusInternalServerError)
+		return
+	}
+	if task == nil {
+		http.Error(w, "no task available", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(task)
+}
+
+// HeartbeatHandler – обработчик POST-запроса, продлевающий аренду задачи,
+// которую агент ещё обрабатывает: старый таймер останавливается и заменяется новым.
+func (a *Application) HeartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	inFlightMutex.Lock()
+	lease, ok := inFlight[id]
+	if !ok {
+		inFlightMutex.Unlock()
+		http.Error(w, "task lease not found", http.StatusNotFound)
+		return
+	}
+
+	tasksMutex.Lock()
+	task, found := tasksByID[id]
+	tasksMutex.Unlock()
+	if !found {
+		delete(inFlight, id)
+		inFlightMutex.Unlock()
+		http.Error(w, "task not found", http.StatusNotFound)
+		return
+	}
+
+	lease.timer.Stop()
+	close(lease.cancel)
+	lease.cancel = make(chan struct{})
+	lease.timer = time.AfterFunc(leaseDuration(a.config, task), func() {
+		expireLease(a.config, a.store, id)
+	})
+	inFlightMutex.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Ошибки submitTaskResult, которые HTTP- и gRPC-транспорты переводят в свои коды/статусы.
+var (
+	errInvalidTaskResult = fmt.Errorf("invalid task result value")
+	errTaskLeaseExpired  = fmt.Errorf("task lease expired")
+	errTaskNotFound      = fmt.Errorf("task not found")
+)
+
+// submitTaskResult – принимает результат задачи от агента независимо от транспорта
+// (HTTP POST /internal/task или поток gRPC AgentService): подставляет результат в
+// родительскую задачу и, когда у той разрешены все зависимости, ставит её в очередь;
+// для корневой задачи завершает Expression.
+func (a *Application) submitTaskResult(res TaskResult) error {
+	if res.Error == "" && (math.IsNaN(res.Result) || math.IsInf(res.Result, 0)) {
+		return errInvalidTaskResult
+	}
+
+	stopped, duration := stopLease(res.ID)
+	if !stopped {
+		return errTaskLeaseExpired
+	}
+
+	tasksMutex.Lock()
+	task, found := tasksByID[res.ID]
+	if !found {
+		tasksMutex.Unlock()
+		return errTaskNotFound
+	}
+	task.Status = "completed"
+	expressionID := task.ExpressionID
+	parentID := task.ParentID
+	parentSlot := task.ParentSlot
+	tasksMutex.Unlock()
+
+	taskDurationSeconds.WithLabelValues(task.Operation).Observe(duration.Seconds())
+
+	if err := a.store.AckTask(res.ID); err != nil {
+		logger.Error("не удалось убрать задачу из хранилища", "task_id", res.ID, "error", err)
+	}
+
+	if res.Error != "" {
+		tasksCompletedTotal.WithLabelValues(task.Operation, "error").Inc()
+		failExpression(a.store, expressionID, fmt.Errorf("задача %s: %s", res.ID, res.Error))
+		return nil
+	}
+	tasksCompletedTotal.WithLabelValues(task.Operation, "ok").Inc()
+	subscriptionHub.Publish(expressionID, Event{Event: "task_completed", TaskID: res.ID, Result: res.Result})
+
+	if parentID == "" {
+		expressionsMutex.Lock()
+		expr, ok := expressions[expressionID]
+		if ok {
+			expr.Status = "completed"
+			expr.Result = res.Result
+		}
+		expressionsMutex.Unlock()
+
+		if ok {
+			if err := a.store.SaveExpression(expr); err != nil {
+				logger.Error("не удалось сохранить завершённое выражение", "expression_id", expressionID, "error", err)
+			}
+			expressionsTotal.WithLabelValues(expr.Status).Inc()
+		}
+
+		subscriptionHub.Publish(expressionID, Event{Event: "expression_completed", Result: res.Result})
+		logger.Info("выражение завершено", "expression_id", expressionID, "result", res.Result)
+		return nil
+	}
+
+	tasksMutex.Lock()
+	parent, ok := tasksByID[parentID]
+	var parentReady bool
+	if ok {
+		if parentSlot == 1 {
+			parent.Arg1 = res.Result
+		} else {
+			parent.Arg2 = res.Result
+		}
+		parent.DependsOn = removeDependency(parent.DependsOn, res.ID)
+		parentReady = len(parent.DependsOn) == 0
+	}
+	tasksMutex.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	if parentReady {
+		if err := a.store.EnqueueTask(parent); err != nil {
+			logger.Error("не удалось поставить задачу в очередь хранилища", "task_id", parent.ID, "error", err)
+		} else {
+			taskQueueDepth.Inc()
+			notifyTaskAvailable()
+		}
+	} else if err := a.store.SaveTask(parent); err != nil {
+		// Родитель ещё не готов: сохраняем частичную подстановку аргумента,
+		// чтобы она не потерялась при перезапуске до завершения последней зависимости
+		logger.Error("не удалось сохранить частично готовую задачу", "task_id", parent.ID, "error", err)
+	}
+
+	return nil
+}
+
+// PostTaskResultHandler – обработчик POST-запроса, которым агент сдаёт результат задачи.
+func (a *Application) PostTaskResultHandler(w http.ResponseWriter, r *http.Request) {
+	var res TaskResult
+	if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+		http.Error(w, "invalid task result payload", http.StatusBadRequest)
+		return
+	}
+
+	switch err := a.submitTaskResult(res); err {
+	case nil:
+		w.WriteHeader(http.StatusOK)
+	case errInvalidTaskResult:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errTaskLeaseExpired:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errTaskNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// removeDependency – удаляет id из списка зависимостей, сохраняя порядок оставшихся
+func removeDependency(deps []string, id string) []string {
+	out := deps[:0]
+	for _, d := range deps {
+		if d != id {
+			out = append(out, d)
+		}
+	}
+	return out
+}
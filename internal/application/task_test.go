@@ -0,0 +1,137 @@
+package application
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// runFakeAgent имитирует агента: забирает готовые задачи и отправляет результат,
+// пока не придёт сигнал остановки.
+func runFakeAgent(stop <-chan struct{}, baseURL string) {
+	client := &http.Client{Timeout: time.Second}
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		resp, err := client.Get(baseURL + "/internal/task")
+		if err != nil {
+			time.Sleep(5 * time.Millisecond)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			time.Sleep(5 * time.Millisecond)
+			continue
+		}
+
+		var task Task
+		json.NewDecoder(resp.Body).Decode(&task)
+		resp.Body.Close()
+
+		var result float64
+		switch task.Operation {
+		case "+":
+			result = task.Arg1 + task.Arg2
+		case "-":
+			result = task.Arg1 - task.Arg2
+		case "*":
+			result = task.Arg1 * task.Arg2
+		case "/":
+			result = task.Arg1 / task.Arg2
+		}
+
+		payload, _ := json.Marshal(TaskResult{ID: task.ID, Result: result})
+		postResp, err := client.Post(baseURL+"/internal/task", "application/json", bytes.NewReader(payload))
+		if err == nil {
+			postResp.Body.Close()
+		}
+	}
+}
+
+func TestParallelAgentsResolveNestedExpression(t *testing.T) {
+	expressions = make(map[string]*Expression)
+	tasksByID = make(map[string]*Task)
+
+	app := &Application{config: ConfigFromEnv(), store: NewMemoryStore()}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/calculate", app.AddExpressionHandler).Methods("POST")
+	r.HandleFunc("/api/v1/expressions/{id}", GetExpressionByIDHandler).Methods("GET")
+	r.HandleFunc("/internal/task", app.GetTaskHandler).Methods("GET")
+	r.HandleFunc("/internal/task", app.PostTaskResultHandler).Methods("POST")
+	r.HandleFunc("/internal/task/{id}/heartbeat", app.HeartbeatHandler).Methods("POST")
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	body, _ := json.Marshal(Request{Expression: "(1+2)*(3+4)"})
+	resp, err := http.Post(server.URL+"/api/v1/calculate", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("calculate request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+
+	var created map[string]string
+	json.NewDecoder(resp.Body).Decode(&created)
+	exprID := created["id"]
+
+	stop := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		go runFakeAgent(stop, server.URL)
+	}
+	defer close(stop)
+
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case <-deadline:
+			t.Fatal("expression did not complete in time")
+		default:
+		}
+
+		resp, err := http.Get(server.URL + "/api/v1/expressions/" + exprID)
+		if err == nil {
+			var expr Expression
+			json.NewDecoder(resp.Body).Decode(&expr)
+			resp.Body.Close()
+			if expr.Status == "completed" {
+				if expr.Result != 21 {
+					t.Fatalf("expected result 21, got %v", expr.Result)
+				}
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDecomposeExpressionLiteral(t *testing.T) {
+	cfg := ConfigFromEnv()
+	_, value, isLiteral, err := decomposeExpression(cfg, NewMemoryStore(), "expr-1", "42")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !isLiteral || value != 42 {
+		t.Fatalf("expected literal 42, got isLiteral=%v value=%v", isLiteral, value)
+	}
+}
+
+func TestDecomposeExpressionInvalid(t *testing.T) {
+	cfg := ConfigFromEnv()
+	_, _, _, err := decomposeExpression(cfg, NewMemoryStore(), "expr-2", "1 +")
+	if err == nil {
+		t.Fatal("expected an error for an invalid expression")
+	}
+}